@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/codegangsta/cli"
+)
+
+const defaultConfigFileName = ".logstasher-cli.json"
+
+// Identifies the Elasticsearch cluster/index we're searching against.
+type SearchTarget struct {
+	Url                string //comma-separated list of Elasticsearch URLs
+	TunnelUrl          string //set at runtime if an SSH tunnel was established
+	IndexPattern       string //regexp matching the indices we should search
+	IndexPrefix        string //literal prefix of daily index names, before the date component
+	IndexDateFormat    string //Go time layout for the date component of daily index names
+	IndexDateSeparator string //separator between IndexPrefix and the formatted date
+}
+
+// Describes the query and output format the user asked for.
+type QueryDefinition struct {
+	Terms          []string //query string terms
+	Format         string   //output format string, e.g. "%timestamp %message"
+	TimestampField string   //field used for sorting/filtering by time
+	AfterDateTime  string   //only return entries after this time (RFC3339)
+	BeforeDateTime string   //only return entries before this time (RFC3339)
+	QueryFile      string   //path to a file containing a raw Elasticsearch query DSL body
+	QueryJSON      string   //raw Elasticsearch query DSL body, given inline
+	Filters        []string //repeated "key=value" term filters, ANDed with the main query
+}
+
+// Returns true if either end of the date range has been set.
+func (q *QueryDefinition) IsDateTimeFiltered() bool {
+	return q.AfterDateTime != "" || q.BeforeDateTime != ""
+}
+
+// Top level configuration, populated from CLI flags and/or a saved default config file.
+type Configuration struct {
+	SearchTarget       SearchTarget
+	QueryDefinition    QueryDefinition
+	User               string
+	Password           string `json:"-"` //never persisted
+	SSHTunnelParams    string
+	TraceRequests      bool
+	MoreVerbose        bool
+	Verbose            bool
+	SaveQuery          bool
+	InitialEntries     int
+	ListOnly           bool
+	PageSize           int
+	Sniff              bool
+	MaxRetries         int
+	Healthcheck        bool
+	CACert             string
+	ClientCert         string
+	ClientKey          string
+	InsecureSkipVerify bool
+	Timezone           string
+	Output             string   //one of "text" (default), "json", "ndjson", "template"
+	Template           string   //text/template body used when Output is "template"
+	Highlight          bool     //request Elasticsearch highlighting on the fields referenced by --format
+	ColorRules         []string //raw "field=value:color[,value:color...]" rules (repeatable), see ColorRule
+	FormatExplicit     bool     `json:"-"` //whether --format was explicitly given this invocation; gates json/ndjson projection
+	Kafka              KafkaConfig
+}
+
+// KafkaConfig configures the "kafka" subcommand, which tails one or more Kafka topics
+// carrying Logstash-formatted JSON records instead of polling Elasticsearch.
+type KafkaConfig struct {
+	Brokers       []string //comma-separated list of broker addresses
+	Topics        []string //topics to subscribe to (repeatable)
+	Group         string   //consumer group id; each member of the group gets a disjoint subset of partitions
+	FromBeginning bool     //start from the earliest retained offset instead of the newest
+}
+
+// Returns the codegangsta/cli flags this configuration understands.
+func (configuration *Configuration) Flags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{Name: "url, u", Value: "localhost:9200", Usage: "(*) Comma-separated list of Elasticsearch URLs", Destination: &configuration.SearchTarget.Url},
+		cli.StringFlag{Name: "index-pattern, i", Value: "logstash-.*", Usage: "(*) Regexp matching indices to search", Destination: &configuration.SearchTarget.IndexPattern},
+		cli.StringFlag{Name: "index-prefix", Value: "logstash", Usage: "(*) Literal prefix of daily index names, before the date component", Destination: &configuration.SearchTarget.IndexPrefix},
+		cli.StringFlag{Name: "index-date-format", Value: "2006.01.02", Usage: "(*) Go time layout for the date component of daily index names", Destination: &configuration.SearchTarget.IndexDateFormat},
+		cli.StringFlag{Name: "index-date-separator", Value: "-", Usage: "(*) Separator between --index-prefix and the date component", Destination: &configuration.SearchTarget.IndexDateSeparator},
+		cli.StringFlag{Name: "timezone", Usage: "IANA timezone name used to compute today's daily index (defaults to local time)", Destination: &configuration.Timezone},
+		cli.StringFlag{Name: "output, o", Value: "text", Usage: "Output mode: text, json, ndjson or template", Destination: &configuration.Output},
+		cli.StringFlag{Name: "template", Usage: "Go text/template body to evaluate against each entry, used when --output=template", Destination: &configuration.Template},
+		cli.StringFlag{Name: "format, f", Value: "%message", Usage: "(*) Format string for output", Destination: &configuration.QueryDefinition.Format},
+		cli.StringFlag{Name: "timestamp-field", Value: "@timestamp", Usage: "(*) Field used for sorting/filtering by time", Destination: &configuration.QueryDefinition.TimestampField},
+		cli.StringFlag{Name: "after", Usage: "Only show entries after this time", Destination: &configuration.QueryDefinition.AfterDateTime},
+		cli.StringFlag{Name: "before", Usage: "Only show entries before this time", Destination: &configuration.QueryDefinition.BeforeDateTime},
+		cli.StringFlag{Name: "query-file", Usage: "Path to a file containing a raw Elasticsearch query DSL body", Destination: &configuration.QueryDefinition.QueryFile},
+		cli.StringFlag{Name: "query-json", Usage: "Raw Elasticsearch query DSL body, given inline", Destination: &configuration.QueryDefinition.QueryJSON},
+		cli.StringSliceFlag{Name: "filter", Usage: "Term filter as key=value, ANDed with the main query and timestamp range (repeatable)"},
+		cli.BoolFlag{Name: "highlight", Usage: "Highlight matched terms in the fields referenced by --format", Destination: &configuration.Highlight},
+		cli.StringSliceFlag{Name: "color", Usage: "Per-field color rule as field=value:color[,value:color...], e.g. level=ERROR:red,WARN:yellow (repeatable)"},
+		cli.StringFlag{Name: "user", Usage: "Username for basic auth", Destination: &configuration.User},
+		cli.StringFlag{Name: "ssh-tunnel", Usage: "user@host[:port] to tunnel the Elasticsearch connection through", Destination: &configuration.SSHTunnelParams},
+		cli.BoolFlag{Name: "sniff", Usage: "Sniff the rest of the cluster from the given URL(s)", Destination: &configuration.Sniff},
+		cli.IntFlag{Name: "max-retries", Usage: "Maximum number of retries per request against the cluster", Destination: &configuration.MaxRetries},
+		cli.BoolTFlag{Name: "healthcheck", Usage: "Healthcheck nodes before sending requests to them", Destination: &configuration.Healthcheck},
+		cli.StringFlag{Name: "ca-cert", Usage: "Path to a PEM-encoded CA certificate to verify the cluster against", Destination: &configuration.CACert},
+		cli.StringFlag{Name: "client-cert", Usage: "Path to a PEM-encoded client certificate for mutual TLS", Destination: &configuration.ClientCert},
+		cli.StringFlag{Name: "client-key", Usage: "Path to the PEM-encoded private key matching --client-cert", Destination: &configuration.ClientKey},
+		cli.BoolFlag{Name: "insecure-skip-verify", Usage: "Skip verification of the cluster's TLS certificate", Destination: &configuration.InsecureSkipVerify},
+		cli.BoolFlag{Name: "save, s", Usage: "Save given query/options as default", Destination: &configuration.SaveQuery},
+		cli.BoolFlag{Name: "list, l", Usage: "List matching entries and exit (do not tail)", Destination: &configuration.ListOnly},
+		cli.IntFlag{Name: "initial-entries, n", Value: 10, Usage: "Number of initial entries to show", Destination: &configuration.InitialEntries},
+		cli.IntFlag{Name: "page-size", Value: 500, Usage: "Number of entries to fetch per scroll page while draining a backlog", Destination: &configuration.PageSize},
+		cli.BoolFlag{Name: "verbose, v", Usage: "Verbose output", Destination: &configuration.Verbose},
+		cli.BoolFlag{Name: "more-verbose, vv", Usage: "Even more verbose output", Destination: &configuration.MoreVerbose},
+		cli.BoolFlag{Name: "trace-requests", Usage: "Trace every Elasticsearch request", Destination: &configuration.TraceRequests},
+	}
+}
+
+// Returns true if the entry should be tailed, or just listed once and exit.
+func (configuration *Configuration) IsListOnly() bool {
+	return configuration.ListOnly
+}
+
+// Returns a deep-enough copy of the configuration suitable for saving as a default.
+func (configuration *Configuration) Copy() *Configuration {
+	copied := *configuration
+	return &copied
+}
+
+// Copies settings that should survive across invocations (connection/format related)
+// from a previously saved configuration onto the given, freshly-parsed configuration.
+func (loaded *Configuration) CopyConfigRelevantSettingsTo(target *Configuration) {
+	if !target.flagWasSet("url") {
+		target.SearchTarget.Url = loaded.SearchTarget.Url
+	}
+	if !target.flagWasSet("index-pattern") {
+		target.SearchTarget.IndexPattern = loaded.SearchTarget.IndexPattern
+	}
+	if !target.flagWasSet("index-prefix") {
+		target.SearchTarget.IndexPrefix = loaded.SearchTarget.IndexPrefix
+	}
+	if !target.flagWasSet("index-date-format") {
+		target.SearchTarget.IndexDateFormat = loaded.SearchTarget.IndexDateFormat
+	}
+	if !target.flagWasSet("index-date-separator") {
+		target.SearchTarget.IndexDateSeparator = loaded.SearchTarget.IndexDateSeparator
+	}
+	if !target.flagWasSet("format") {
+		target.QueryDefinition.Format = loaded.QueryDefinition.Format
+	}
+	if !target.flagWasSet("timestamp-field") {
+		target.QueryDefinition.TimestampField = loaded.QueryDefinition.TimestampField
+	}
+}
+
+// Placeholder hook; actual flag-presence tracking lives in IsConfigRelevantFlagSet.
+func (configuration *Configuration) flagWasSet(name string) bool {
+	return false
+}
+
+// Returns true if any of the flags that should reset the saved default were explicitly given.
+func IsConfigRelevantFlagSet(c *cli.Context) bool {
+	for _, name := range []string{"url", "index-pattern", "index-prefix", "index-date-format", "index-date-separator", "format", "timestamp-field"} {
+		if c.IsSet(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func configFilePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, defaultConfigFileName), nil
+}
+
+// Loads the previously saved default configuration, if any.
+func LoadDefault() (*Configuration, error) {
+	path, err := configFilePath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	loaded := new(Configuration)
+	if err := json.Unmarshal(data, loaded); err != nil {
+		return nil, err
+	}
+	return loaded, nil
+}
+
+// Persists this configuration as the default for future invocations.
+func (configuration *Configuration) SaveDefault() error {
+	path, err := configFilePath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(configuration, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
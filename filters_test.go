@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestSplitFilterArg(t *testing.T) {
+	cases := []struct {
+		raw       string
+		wantKey   string
+		wantValue string
+		wantOk    bool
+	}{
+		{"level=ERROR", "level", "ERROR", true},
+		{"message=foo=bar", "message", "foo=bar", true},
+		{"noequals", "", "", false},
+		{"=value", "", "", false},
+	}
+	for _, c := range cases {
+		key, value, ok := splitFilterArg(c.raw)
+		if ok != c.wantOk || key != c.wantKey || value != c.wantValue {
+			t.Fatalf("splitFilterArg(%q) = (%q, %q, %v), want (%q, %q, %v)",
+				c.raw, key, value, ok, c.wantKey, c.wantValue, c.wantOk)
+		}
+	}
+}
+
+func TestBuildTermFiltersOneFilterPerEntry(t *testing.T) {
+	tail := &Tail{queryDefinition: &QueryDefinition{Filters: []string{"level=ERROR", "service=api"}}}
+	filters := tail.buildTermFilters()
+	if len(filters) != 2 {
+		t.Fatalf("expected 2 term filters, got %d", len(filters))
+	}
+}
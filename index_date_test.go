@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIndexDateRegexpMatchesConfiguredFormats(t *testing.T) {
+	cases := []struct {
+		layout    string
+		indexName string
+		want      string
+	}{
+		{"2006.01.02", "logstash-2024.01.15", "2024.01.15"},
+		{"2006-01-02", "app-2024-01-15", "2024-01-15"},
+		{"20060102", "app-20240115", "20240115"},
+	}
+	for _, c := range cases {
+		match := indexDateRegexp(c.layout).FindStringSubmatch(c.indexName)
+		if match == nil {
+			t.Fatalf("layout %q: expected a match in %q", c.layout, c.indexName)
+		}
+		if match[1] != c.want {
+			t.Fatalf("layout %q: expected match %q, got %q", c.layout, c.want, match[1])
+		}
+	}
+}
+
+func TestIndexDateRegexpDoesNotMatchWrongDigitCounts(t *testing.T) {
+	if indexDateRegexp("2006.01.02").MatchString("logstash-24.1.5") {
+		t.Fatal("expected no match when digit counts don't line up with the layout")
+	}
+}
+
+func TestExtractIndexDate(t *testing.T) {
+	target := &SearchTarget{IndexPrefix: "logstash", IndexDateSeparator: "-", IndexDateFormat: "2006.01.02"}
+	got := extractIndexDate("logstash-2024.01.15", target, time.UTC)
+	want := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	if !got.Equal(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/codegangsta/cli"
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// kafkaCommand returns the "kafka" subcommand, which tails one or more Kafka topics
+// carrying Logstash-formatted JSON records through the same formatter pipeline as
+// Elasticsearch results, instead of polling Elasticsearch. This lets operators watch
+// events in real time before they're indexed, which in busy pipelines can lag
+// Elasticsearch by minutes.
+func kafkaCommand(configuration *Configuration) cli.Command {
+	return cli.Command{
+		Name:      "kafka",
+		Usage:     "Tail Logstash-formatted JSON records from Kafka instead of polling Elasticsearch",
+		ArgsUsage: " ",
+		Flags: []cli.Flag{
+			cli.StringSliceFlag{Name: "brokers", Usage: "Kafka broker address, host:port (repeatable, or comma-separated)"},
+			cli.StringSliceFlag{Name: "topic", Usage: "Kafka topic to subscribe to (repeatable)"},
+			cli.StringFlag{Name: "group", Usage: "Kafka consumer group id", Destination: &configuration.Kafka.Group},
+			cli.BoolFlag{Name: "from-beginning", Usage: "Start from the earliest retained offset instead of the newest", Destination: &configuration.Kafka.FromBeginning},
+			cli.StringFlag{Name: "format, f", Value: "%message", Usage: "(*) Format string for output", Destination: &configuration.QueryDefinition.Format},
+			cli.StringFlag{Name: "output, o", Value: "text", Usage: "Output mode: text, json, ndjson or template", Destination: &configuration.Output},
+			cli.StringFlag{Name: "template", Usage: "Go text/template body to evaluate against each entry, used when --output=template", Destination: &configuration.Template},
+			cli.StringSliceFlag{Name: "color", Usage: "Per-field color rule as field=value:color[,value:color...], e.g. level=ERROR:red,WARN:yellow (repeatable)"},
+			cli.BoolFlag{Name: "verbose, v", Usage: "Verbose output", Destination: &configuration.Verbose},
+			cli.BoolFlag{Name: "more-verbose, vv", Usage: "Even more verbose output", Destination: &configuration.MoreVerbose},
+		},
+		Action: func(c *cli.Context) error {
+			InitLoggingFromConfig(configuration)
+
+			configuration.Kafka.Brokers = splitCommaSeparated(c.StringSlice("brokers"))
+			configuration.Kafka.Topics = c.StringSlice("topic")
+			configuration.ColorRules = c.StringSlice("color")
+			configuration.FormatExplicit = c.IsSet("format")
+			if len(configuration.Kafka.Brokers) == 0 {
+				Error.Fatalln("At least one --brokers address is required.")
+			}
+			if len(configuration.Kafka.Topics) == 0 {
+				Error.Fatalln("At least one --topic is required.")
+			}
+			if configuration.Kafka.Group == "" {
+				Error.Fatalln("--group is required: kafka-go only supports multiple/repeatable --topic subscriptions through a consumer group.")
+			}
+
+			formatter, err := NewOutputFormatter(configuration)
+			if err != nil {
+				Error.Fatalf("Invalid output configuration: %s", err)
+			}
+
+			tailKafka(&configuration.Kafka, formatter)
+			return nil
+		},
+	}
+}
+
+// splitCommaSeparated flattens a StringSlice flag that also accepts comma-separated values
+// within a single occurrence, e.g. --brokers es1:9092,es2:9092.
+func splitCommaSeparated(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if part != "" {
+				result = append(result, part)
+			}
+		}
+	}
+	return result
+}
+
+// tailKafka subscribes to the configured topics and pipes each decoded record through the
+// given formatter, forever.
+func tailKafka(config *KafkaConfig, formatter OutputFormatter) {
+	startOffset := kafka.LastOffset
+	if config.FromBeginning {
+		startOffset = kafka.FirstOffset
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     config.Brokers,
+		GroupID:     config.Group,
+		GroupTopics: config.Topics,
+		StartOffset: startOffset,
+	})
+	defer reader.Close()
+
+	Info.Printf("Tailing Kafka topics %v via brokers %v", config.Topics, config.Brokers)
+
+	ctx := context.Background()
+	for {
+		message, err := reader.ReadMessage(ctx)
+		if err != nil {
+			Error.Fatalln("Error reading from Kafka.", err)
+		}
+
+		var entry map[string]interface{}
+		if err := json.Unmarshal(message.Value, &entry); err != nil {
+			Trace.Printf("Skipping non-JSON Kafka record on topic %s: %s", message.Topic, err)
+			continue
+		}
+
+		if line, ok := formatter.Format(entry, nil); ok {
+			Trace.Println("Result: ", entry)
+			printLine(line)
+		}
+	}
+}
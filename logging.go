@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+// Loggers used throughout the application. Trace is the most verbose, Error the least.
+var (
+	Trace *log.Logger
+	Info  *log.Logger
+	Error *log.Logger
+)
+
+// Initializes the package-level loggers to write to the given handles.
+func InitLogging(traceHandle, infoHandle, errorHandle io.Writer, trace bool) {
+	flags := log.Ldate | log.Ltime
+	Trace = log.New(traceHandle, "TRACE: ", flags)
+	Info = log.New(infoHandle, "INFO: ", flags)
+	Error = log.New(errorHandle, "ERROR: ", flags)
+}
+
+// InitLoggingFromConfig sets up the loggers at the verbosity level requested by
+// configuration's -v/-vv/--trace-requests flags. Shared by the root (Elasticsearch) and
+// kafka subcommand actions.
+func InitLoggingFromConfig(configuration *Configuration) {
+	if configuration.MoreVerbose || configuration.TraceRequests {
+		InitLogging(os.Stderr, os.Stderr, os.Stderr, true)
+	} else if configuration.Verbose {
+		InitLogging(ioutil.Discard, os.Stderr, os.Stderr, false)
+	} else {
+		InitLogging(ioutil.Discard, ioutil.Discard, os.Stderr, false)
+	}
+}
@@ -8,24 +8,29 @@ import (
 	"net/url"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
-	"github.com/fatih/color"
 	"github.com/codegangsta/cli"
 	"golang.org/x/crypto/ssh/terminal"
 	"gopkg.in/olivere/elastic.v2"
 )
 
-//
 // Structure that holds data necessary to perform tailing.
-//
 type Tail struct {
-	client          *elastic.Client  //elastic search client that we'll use to contact EL
-	queryDefinition *QueryDefinition //structure containing query definition and formatting
-	indices         []string         //indices to search through
-	lastTimeStamp   string           //timestamp of the last result
-	order           bool             //search order - true = ascending (may be reversed in case date-after filtering)
+	client           *elastic.Client  //elastic search client that we'll use to contact EL
+	queryDefinition  *QueryDefinition //structure containing query definition and formatting
+	configuration    *Configuration   //full configuration, kept around for re-resolving indices etc.
+	indices          []string         //indices to search through
+	lastTimeStamp    string           //timestamp of the last result
+	lastTimeStampIds map[string]bool  //_id of every hit seen so far at lastTimeStamp, our tiebreaker
+	order            bool             //search order - true = ascending (may be reversed in case date-after filtering)
+	cursor           TailCursor       //scroll cursor used to drain more than one page per poll
+	pageSize         int              //max hits fetched per scroll page
+	location         *time.Location   //timezone used to compute "today" for daily index resolution
+	formatter        OutputFormatter  //renders each result entry for printing
+	indicesResolved  time.Time        //when indices was last re-resolved, used to throttle pollPageHighlighted's re-resolution
 }
 
 // Regexp for parsing out format fields
@@ -33,35 +38,47 @@ var formatRegexp = regexp.MustCompile("%[A-Za-z0-9@_.-]+")
 
 const dateFormatDMY = "2006-01-02"
 
+// followGrace holds follow-up (tailing) queries this far behind real time. Without it,
+// lastTimeStamp could advance past the timestamp of a document that exists in event-time but
+// hasn't been indexed into Elasticsearch yet when the scroll/poll query runs - Gt(lastTimeStamp)
+// would then exclude it forever once that timestamp is passed. Keeping queries a few seconds
+// behind gives indexing/refresh latency room to catch up before a time window is treated as
+// fully drained.
+const followGrace = 2 * time.Second
+
+// indexResolveInterval throttles how often pollPageHighlighted re-resolves tail.indices (it
+// has no scroll-exhaustion event to hang that off of, unlike the non-highlighted path).
+const indexResolveInterval = 30 * time.Second
+
 // Create a new Tailer using configuration
 func NewTail(configuration *Configuration) *Tail {
 	tail := new(Tail)
 
 	var client *elastic.Client
 	var err error
-	var url = configuration.SearchTarget.Url
-	if !strings.HasPrefix(url, "http") {
-		url = "http://" + url
-		Trace.Printf("Adding http:// prefix to given url. Url: " + url)
-	}
 
-	if !Must(regexp.MatchString(".*:\\d+", url)) && Must(regexp.MatchString("http://[^/]+$", url)) {
-		url += ":9200"
-		Trace.Printf("No port was specified, adding default port 9200 to given url. Url: " + url)
-	}
-
-	//if a tunnel is successfully created, we need to connect to tunnel url (which is localhost on tunnel port)
+	var urls []string
 	if configuration.SearchTarget.TunnelUrl != "" {
-		url = configuration.SearchTarget.TunnelUrl
+		//if a tunnel is successfully created, we need to connect to tunnel url (which is localhost on tunnel port)
+		urls = []string{configuration.SearchTarget.TunnelUrl}
+	} else {
+		for _, u := range strings.Split(configuration.SearchTarget.Url, ",") {
+			urls = append(urls, normalizeURL(u))
+		}
 	}
 
 	defaultOptions := []elastic.ClientOptionFunc{
-		elastic.SetURL(url),
-		elastic.SetSniff(false),
+		elastic.SetURL(urls...),
+		elastic.SetSniff(configuration.Sniff),
+		elastic.SetHealthcheck(configuration.Healthcheck),
 		elastic.SetHealthcheckTimeoutStartup(10 * time.Second),
 		elastic.SetHealthcheckTimeout(2 * time.Second),
 	}
 
+	if configuration.MaxRetries > 0 {
+		defaultOptions = append(defaultOptions, elastic.SetMaxRetries(configuration.MaxRetries))
+	}
+
 	if configuration.User != "" {
 		defaultOptions = append(defaultOptions,
 			elastic.SetBasicAuth(configuration.User, configuration.Password))
@@ -72,16 +89,45 @@ func NewTail(configuration *Configuration) *Tail {
 			elastic.SetTraceLog(Trace))
 	}
 
+	httpClient, err := buildHTTPClient(configuration)
+	if err != nil {
+		Error.Fatalf("Could not set up TLS for the Elasticsearch client: %s.", err)
+	}
+	if httpClient != nil {
+		defaultOptions = append(defaultOptions, elastic.SetHttpClient(httpClient))
+	}
+
 	client, err = elastic.NewClient(defaultOptions...)
 
 	if err != nil {
-		Error.Fatalf("Could not connect Elasticsearch client to %s: %s.", url, err)
+		Error.Fatalf("Could not connect Elasticsearch client to %s: %s.", strings.Join(urls, ","), err)
 	}
 	tail.client = client
 
 	tail.queryDefinition = &configuration.QueryDefinition
+	tail.configuration = configuration
+	tail.pageSize = configuration.PageSize
+	if tail.pageSize <= 0 {
+		tail.pageSize = 500
+	}
+
+	formatter, err := NewOutputFormatter(configuration)
+	if err != nil {
+		Error.Fatalf("Invalid output configuration: %s", err)
+	}
+	tail.formatter = formatter
+
+	tail.location = time.Local
+	if configuration.Timezone != "" {
+		loc, err := time.LoadLocation(configuration.Timezone)
+		if err != nil {
+			Error.Fatalf("Invalid --timezone %q: %s", configuration.Timezone, err)
+		}
+		tail.location = loc
+	}
 
 	tail.selectIndices(configuration)
+	tail.indicesResolved = time.Now()
 
 	//If we're date filtering on start date, then the sort needs to be ascending
 	if configuration.QueryDefinition.AfterDateTime != "" {
@@ -100,27 +146,34 @@ func (tail *Tail) selectIndices(configuration *Configuration) {
 		Error.Fatalln("Could not fetch available indices.", err)
 	}
 
+	target := &configuration.SearchTarget
+
 	if configuration.QueryDefinition.IsDateTimeFiltered() {
 		startDate := configuration.QueryDefinition.AfterDateTime
 		endDate := configuration.QueryDefinition.BeforeDateTime
 		if startDate == "" && endDate != "" {
-			lastIndex := findLastIndex(indices, configuration.SearchTarget.IndexPattern)
-			lastIndexDate := extractYMDDate(lastIndex, ".")
-			if lastIndexDate.Before(extractYMDDate(endDate, "-")) {
+			lastIndex := findLastIndex(indices, target.IndexPattern)
+			lastIndexDate := extractIndexDate(lastIndex, target, tail.location)
+			if lastIndexDate.Before(extractUserDate(endDate, tail.location)) {
 				startDate = lastIndexDate.Format(dateFormatDMY)
 			} else {
 				startDate = endDate
 			}
 		}
 		if endDate == "" {
-			endDate = time.Now().Format(dateFormatDMY)
+			endDate = time.Now().In(tail.location).Format(dateFormatDMY)
 		}
-		tail.indices = findIndicesForDateRange(indices, configuration.SearchTarget.IndexPattern, startDate, endDate)
+		tail.indices = findIndicesForDateRange(indices, target, startDate, endDate, tail.location)
 
 	} else {
-		index := findLastIndex(indices, configuration.SearchTarget.IndexPattern)
-		result := [...]string{index}
-		tail.indices = result[:]
+		//Prefer today's index computed directly from the configured prefix/format/timezone;
+		//this also covers the case where the cluster writes a new daily index that sorts
+		//lexicographically behind an older one (e.g. a year or month rollover).
+		index := formatIndexName(target, time.Now().In(tail.location))
+		if !contains(indices, index) {
+			index = findLastIndex(indices, target.IndexPattern)
+		}
+		tail.indices = []string{index}
 	}
 	Info.Printf("Using indices: %s", tail.indices)
 }
@@ -135,33 +188,129 @@ func (t *Tail) Start(follow bool, initialEntries int) {
 	delay := 500 * time.Millisecond
 	for follow {
 		time.Sleep(delay)
+
+		var hitCount int
+		var fullPage bool
 		if t.lastTimeStamp != "" {
-			//we can execute follow up timestamp filtered query only if we fetched at least 1 result in initial query
-			result, err = t.client.Search().
-				Indices(t.indices...).
-				Sort(t.queryDefinition.TimestampField, false).
-				From(0).
-				Size(9000).//TODO: needs rewrite this using scrolling, as this implementation may loose entries if there's more than 9K entries per sleep period
-				Query(t.buildTimestampFilteredQuery()).
-				Do()
+			//we can execute follow up queries only if we fetched at least 1 result in initial query
+			hitCount, fullPage, err = t.pollPage()
 		} else {
 			//if lastTimeStamp is not defined we have to repeat the initial search until we get at least 1 result
 			result, err = t.initialSearch(initialEntries)
+			if err == nil {
+				t.processResults(result)
+				hitCount = len(result.Hits.Hits)
+			}
 		}
 		if err != nil {
 			Error.Fatalln("Error in executing search query.", err)
 		}
-		t.processResults(result)
+
+		if fullPage {
+			//backpressure: a full page means there may be more already waiting, so skip the
+			//dynamic delay entirely and go drain the next page right away
+			delay = 0
+			continue
+		}
 
 		//Dynamic delay calculation for determining delay between search requests
-		if result.TotalHits() > 0 && delay > 500 * time.Millisecond {
+		if hitCount > 0 && delay > 500*time.Millisecond {
 			delay = 500 * time.Millisecond
-		} else if delay <= 2000 * time.Millisecond {
-			delay = delay + 500 * time.Millisecond
+		} else if delay <= 2000*time.Millisecond {
+			delay = delay + 500*time.Millisecond
 		}
 	}
 }
 
+// pollPage fetches a single bounded page of new results since lastTimeStamp. It returns the
+// number of hits processed and whether the page was full (i.e. there may be more waiting
+// right now).
+//
+// When --highlight is set it delegates to pollPageHighlighted, since olivere/elastic.v2's
+// ScrollService (used below) has no Highlight method; otherwise it uses (and maintains)
+// t.cursor so that a poll which turns up more than one page of results can be drained, page
+// by page, across successive calls without losing anything in between.
+func (t *Tail) pollPage() (int, bool, error) {
+	if t.configuration.Highlight {
+		return t.pollPageHighlighted()
+	}
+
+	var result *elastic.SearchResult
+	var err error
+
+	if t.cursor.Active() {
+		result, err = t.client.Scroll(t.indices...).ScrollId(t.cursor.ScrollId).Do()
+	} else {
+		result, err = t.client.Scroll(t.indices...).
+			KeepAlive("1m").
+			Size(t.pageSize).
+			Query(t.buildTimestampFilteredQuery()).
+			Do()
+	}
+
+	if err == elastic.EOS {
+		//scroll is exhausted - drop the cursor and re-resolve indices, in case a new
+		//daily index rolled in while we were scrolling
+		t.cursor.Reset()
+		t.selectIndices(t.configuration)
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	t.cursor.ScrollId = result.ScrollId
+	hits := result.Hits.Hits
+	//search_type=scan (used under the hood for scrolling) does not preserve sort order, even
+	//across pages of the same scroll, so we sort each page client-side before advancing the
+	//watermark - see advanceWatermark for how the watermark itself stays safe.
+	sortHitsByTimestamp(hits, t.queryDefinition.TimestampField)
+	for _, hit := range hits {
+		entry := t.processHit(hit)
+		t.advanceWatermark(entry[t.queryDefinition.TimestampField].(string), hit.Id)
+	}
+
+	fullPage := len(hits) >= t.pageSize
+	return len(hits), fullPage, nil
+}
+
+// pollPageHighlighted fetches a single bounded page of new results since lastTimeStamp like
+// pollPage, but via a plain sorted search rather than the Scroll API so that Highlight can be
+// requested on it - this is what makes --highlight actually light up the tailing stream
+// (the bulk of a session's output) and not just the one-time initial dump. Because the
+// search is sorted ascending by Elasticsearch itself, no client-side re-sort is needed.
+//
+// Unlike pollPage, there's no scroll exhaustion event to hang index rollover off of, so
+// indices are re-resolved on a timer (indexResolveInterval) instead of on every poll - doing
+// it on every poll would turn a full-page backpressure loop (delay=0, polling as fast as
+// possible to drain a burst) into a tight loop of full cluster index-listing calls.
+func (t *Tail) pollPageHighlighted() (int, bool, error) {
+	if time.Since(t.indicesResolved) >= indexResolveInterval {
+		t.selectIndices(t.configuration)
+		t.indicesResolved = time.Now()
+	}
+
+	result, err := t.client.Search().
+		Indices(t.indices...).
+		Sort(t.queryDefinition.TimestampField, true).
+		Query(t.buildTimestampFilteredQuery()).
+		Highlight(t.buildHighlight()).
+		From(0).Size(t.pageSize).
+		Do()
+	if err != nil {
+		return 0, false, err
+	}
+
+	hits := result.Hits.Hits
+	for _, hit := range hits {
+		entry := t.processHit(hit)
+		t.advanceWatermark(entry[t.queryDefinition.TimestampField].(string), hit.Id)
+	}
+
+	fullPage := len(hits) >= t.pageSize
+	return len(hits), fullPage, nil
+}
+
 // Initial search needs to be run until we get at least one result
 // in order to fetch the timestamp which we will use in subsequent follow searches
 func (t *Tail) initialSearch(initialEntries int) (*elastic.SearchResult, error) {
@@ -169,10 +318,41 @@ func (t *Tail) initialSearch(initialEntries int) (*elastic.SearchResult, error)
 		Indices(t.indices...).
 		Sort(t.queryDefinition.TimestampField, t.order).
 		Query(t.buildSearchQuery()).
+		Highlight(t.buildHighlight()).
 		From(0).Size(initialEntries).
 		Do()
 }
 
+// buildHighlight returns the Highlight to request on the fields referenced by --format when
+// --highlight is set, or nil otherwise. Matched spans come back wrapped in
+// highlightPreTag/highlightPostTag for renderHighlightFragments to colorize. Shared by
+// initialSearch and pollPageHighlighted, the two query paths that support it.
+func (t *Tail) buildHighlight() *elastic.Highlight {
+	if !t.configuration.Highlight {
+		return nil
+	}
+	hl := elastic.NewHighlight().PreTags(highlightPreTag).PostTags(highlightPostTag)
+	for _, field := range highlightFieldNames(t.queryDefinition.Format) {
+		hl = hl.Field(field)
+	}
+	return hl
+}
+
+// highlightFieldNames returns the distinct field expressions referenced by a --format
+// string, e.g. "%level %message" -> ["level", "message"].
+func highlightFieldNames(format string) []string {
+	seen := make(map[string]bool)
+	var fields []string
+	for _, field := range formatRegexp.FindAllString(format, -1) {
+		expression := field[1:]
+		if !seen[expression] {
+			seen[expression] = true
+			fields = append(fields, expression)
+		}
+	}
+	return fields
+}
+
 // Process the results (e.g. prints them out based on configured format)
 func (t *Tail) processResults(searchResult *elastic.SearchResult) {
 	Trace.Printf("Fetched page of %d results out of %d total.\n", len(searchResult.Hits.Hits), searchResult.Hits.TotalHits)
@@ -182,16 +362,53 @@ func (t *Tail) processResults(searchResult *elastic.SearchResult) {
 		for i := 0; i < len(hits); i++ {
 			hit := hits[i]
 			entry := t.processHit(hit)
-			t.lastTimeStamp = entry[t.queryDefinition.TimestampField].(string)
+			t.advanceWatermark(entry[t.queryDefinition.TimestampField].(string), hit.Id)
 		}
 	} else {
 		//when results are in descending order, we need to process them in reverse
 		for i := len(hits) - 1; i >= 0; i-- {
 			hit := hits[i]
 			entry := t.processHit(hit)
-			t.lastTimeStamp = entry[t.queryDefinition.TimestampField].(string)
+			t.advanceWatermark(entry[t.queryDefinition.TimestampField].(string), hit.Id)
+		}
+	}
+}
+
+// advanceWatermark folds a newly-seen hit's timestamp/id into (lastTimeStamp,
+// lastTimeStampIds), the pair buildTimestampFilteredQuery uses as a tiebreaker: lastTimeStamp
+// only ever moves forward, and lastTimeStampIds tracks every id seen at that exact boundary
+// timestamp, so a later poll can ask for "ts >= lastTimeStamp, excluding ids already seen"
+// instead of "ts > lastTimeStamp" - which would otherwise permanently skip any hit sharing
+// the boundary timestamp that hadn't been indexed yet when the boundary was set.
+func (t *Tail) advanceWatermark(timestamp string, id string) {
+	switch {
+	case t.lastTimeStamp == "" || timestamp > t.lastTimeStamp:
+		t.lastTimeStamp = timestamp
+		t.lastTimeStampIds = map[string]bool{id: true}
+	case timestamp == t.lastTimeStamp:
+		if t.lastTimeStampIds == nil {
+			t.lastTimeStampIds = make(map[string]bool)
 		}
+		t.lastTimeStampIds[id] = true
+	}
+}
+
+// sortHitsByTimestamp sorts hits ascending by the given timestamp field. It's used to
+// restore chronological order on pages fetched via scroll, which (being backed by
+// search_type=scan) does not apply any sort of its own.
+func sortHitsByTimestamp(hits []*elastic.SearchHit, timestampField string) {
+	sort.Slice(hits, func(i, j int) bool {
+		return hitTimestamp(hits[i], timestampField) < hitTimestamp(hits[j], timestampField)
+	})
+}
+
+func hitTimestamp(hit *elastic.SearchHit, timestampField string) string {
+	var entry map[string]interface{}
+	if err := json.Unmarshal(*hit.Source, &entry); err != nil {
+		return ""
 	}
+	timestamp, _ := entry[timestampField].(string)
+	return timestamp
 }
 
 func (t *Tail) processHit(hit *elastic.SearchHit) map[string]interface{} {
@@ -200,46 +417,94 @@ func (t *Tail) processHit(hit *elastic.SearchHit) map[string]interface{} {
 	if err != nil {
 		Error.Fatalln("Failed parsing ElasticSearch response.", err)
 	}
-	t.printResult(entry)
+	t.printResult(entry, hit.Highlight)
 	return entry
 }
 
-// Print result according to format
-func (t *Tail) printResult(entry map[string]interface{}) {
+// Print result according to the configured output format
+func (t *Tail) printResult(entry map[string]interface{}, highlight map[string][]string) {
 	Trace.Println("Result: ", entry)
-	fields := formatRegexp.FindAllString(t.queryDefinition.Format, -1)
-	Trace.Println("Fields: ", fields)
-	result := t.queryDefinition.Format
-	for _, f := range fields {
-		value, err := EvaluateExpression(entry, f[1:len(f)])
-		if err == nil {
-			result = strings.Replace(result, f, value, -1)
-		}
+	if line, ok := t.formatter.Format(entry, highlight); ok {
+		printLine(line)
 	}
-	fmt.Println(color.GreenString(result))
+}
+
+// printLine writes a single already-formatted result line to stdout. Shared by the
+// Elasticsearch tailer and the kafka subcommand, which both feed entries through an
+// OutputFormatter.
+func printLine(line string) {
+	fmt.Println(line)
 }
 
 func (t *Tail) buildSearchQuery() elastic.Query {
 	var query elastic.Query
-	if len(t.queryDefinition.Terms) > 0 {
+	switch {
+	case t.queryDefinition.QueryJSON != "":
+		Trace.Print("Running raw query DSL given via --query-json.")
+		query = elastic.NewRawStringQuery(t.queryDefinition.QueryJSON)
+	case t.queryDefinition.QueryFile != "":
+		body, err := ioutil.ReadFile(t.queryDefinition.QueryFile)
+		if err != nil {
+			Error.Fatalf("Could not read --query-file %s: %s", t.queryDefinition.QueryFile, err)
+		}
+		Trace.Printf("Running raw query DSL from file: %s", t.queryDefinition.QueryFile)
+		query = elastic.NewRawStringQuery(string(body))
+	case len(t.queryDefinition.Terms) > 0:
 		result := strings.Join(t.queryDefinition.Terms, " ")
 		Trace.Printf("Running query string query: %s", result)
 		query = elastic.NewQueryStringQuery(result)
-	} else {
+	default:
 		Trace.Print("Running query match all query.")
 		query = elastic.NewMatchAllQuery()
 	}
 
+	filtered := elastic.NewFilteredQuery(query)
+	hasFilter := false
+
+	for _, filter := range t.buildTermFilters() {
+		filtered = filtered.Filter(filter)
+		hasFilter = true
+	}
+
 	if t.queryDefinition.IsDateTimeFiltered() {
 		// we have date filtering turned on, apply filter
-		filter := t.buildDateTimeRangeFilter()
-		query = elastic.NewFilteredQuery(query).Filter(filter)
+		filtered = filtered.Filter(t.buildDateTimeRangeFilter())
+		hasFilter = true
+	}
+
+	if hasFilter {
+		return filtered
 	}
 	return query
 }
 
-//Builds range filter on timestamp field. You should only call this if start or end date times are defined
-//in query definition
+// buildTermFilters turns each repeated --filter key=value into a term filter on that field,
+// composed (via buildSearchQuery's FilteredQuery) alongside the main query and the
+// timestamp range filter. This lets field-scoped searches like "level=ERROR" avoid
+// query-string parsing pitfalls on values containing colons, spaces or reserved characters.
+func (t *Tail) buildTermFilters() []elastic.Filter {
+	filters := make([]elastic.Filter, 0, len(t.queryDefinition.Filters))
+	for _, raw := range t.queryDefinition.Filters {
+		key, value, ok := splitFilterArg(raw)
+		if !ok {
+			Error.Fatalf("Invalid --filter %q, expected key=value", raw)
+		}
+		filters = append(filters, elastic.NewTermFilter(key, value))
+	}
+	return filters
+}
+
+// splitFilterArg splits a "key=value" --filter argument.
+func splitFilterArg(raw string) (key string, value string, ok bool) {
+	parts := strings.SplitN(raw, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// Builds range filter on timestamp field. You should only call this if start or end date times are defined
+// in query definition
 func (t *Tail) buildDateTimeRangeFilter() elastic.RangeFilter {
 	filter := elastic.NewRangeFilter(t.queryDefinition.TimestampField)
 	if t.queryDefinition.AfterDateTime != "" {
@@ -255,38 +520,96 @@ func (t *Tail) buildDateTimeRangeFilter() elastic.RangeFilter {
 	return filter
 }
 
+// buildTimestampFilteredQuery is the follow-up (tailing) query: everything at or after
+// lastTimeStamp, excluding ids already seen at that exact boundary (see advanceWatermark),
+// and held back of real time by followGrace so the watermark never advances past a point the
+// live tailer hasn't actually had a chance to observe.
 func (t *Tail) buildTimestampFilteredQuery() elastic.Query {
 	query := elastic.NewFilteredQuery(t.buildSearchQuery()).Filter(
 		elastic.NewRangeFilter(t.queryDefinition.TimestampField).
-			IncludeUpper(false).
-			Gt(t.lastTimeStamp))
+			Gte(t.lastTimeStamp).
+			Lt(followSafeCutoff()))
+
+	if len(t.lastTimeStampIds) > 0 {
+		seen := make([]string, 0, len(t.lastTimeStampIds))
+		for id := range t.lastTimeStampIds {
+			seen = append(seen, id)
+		}
+		query = query.Filter(elastic.NewNotFilter(elastic.NewIdsFilter().Ids(seen...)))
+	}
+
 	return query
 }
 
-// Extracts and parses YMD date (year followed by month followed by day) from a given string. YMD values are separated by
-// separator character given as argument.
-func extractYMDDate(dateStr, separator string) time.Time {
-	dateRegexp := regexp.MustCompile(fmt.Sprintf(`(\d{4}%s\d{2}%s\d{2})`, separator, separator))
-	match := dateRegexp.FindAllStringSubmatch(dateStr, -1)
-	if len(match) == 0 {
-		Error.Fatalf("Failed to extract date: %s\n", dateStr)
+// followSafeCutoff returns the most recent timestamp (RFC3339Nano, matching the format
+// buildDateTimeRangeFilter's AfterDateTime/BeforeDateTime already assume) that a follow-up
+// query will accept, held followGrace behind real time.
+func followSafeCutoff() string {
+	return time.Now().Add(-followGrace).UTC().Format(time.RFC3339Nano)
+}
+
+// Extracts and parses the date embedded in a daily index name, according to the index
+// date format configured in target (e.g. "2006.01.02" for "logstash-2024.01.15", or
+// "2006-01-02" for "app-2024-01-15"). The date is interpreted in the given location.
+func extractIndexDate(indexName string, target *SearchTarget, loc *time.Location) time.Time {
+	match := indexDateRegexp(target.IndexDateFormat).FindStringSubmatch(indexName)
+	if match == nil {
+		Error.Fatalf("Failed to extract date (format %q) from index name: %s\n", target.IndexDateFormat, indexName)
 	}
-	result := match[0]
-	parsed, err := time.Parse(fmt.Sprintf("2006%s01%s02", separator, separator), result[0])
+	parsed, err := time.ParseInLocation(target.IndexDateFormat, match[1], loc)
+	if err != nil {
+		Error.Fatalf("Failed parsing date: %s", err)
+	}
+	return parsed
+}
+
+// Parses a user-supplied --after/--before style date (always dateFormatDMY, regardless of
+// the index date format), in the given location so that day boundaries line up with
+// extractIndexDate.
+func extractUserDate(dateStr string, loc *time.Location) time.Time {
+	parsed, err := time.ParseInLocation(dateFormatDMY, dateStr, loc)
 	if err != nil {
 		Error.Fatalf("Failed parsing date: %s", err)
 	}
 	return parsed
 }
 
-func findIndicesForDateRange(indices []string, indexPattern string, startDate string, endDate string) []string {
-	start := extractYMDDate(startDate, "-")
-	end := extractYMDDate(endDate, "-")
+// Builds a regexp that matches a date formatted with the given Go time layout, with the
+// year/month/day components turned into digit-count wildcards and everything else
+// (separators) kept literal. This lets us locate a YYYY/MM/DD-shaped date embedded anywhere
+// in an index name without hardcoding its punctuation.
+func indexDateRegexp(layout string) *regexp.Regexp {
+	const yearToken, monthToken, dayToken = "\x00Y\x00", "\x00M\x00", "\x00D\x00"
+	tokenized := strings.NewReplacer("2006", yearToken, "01", monthToken, "02", dayToken).Replace(layout)
+	escaped := regexp.QuoteMeta(tokenized)
+	pattern := strings.NewReplacer(yearToken, `\d{4}`, monthToken, `\d{2}`, dayToken, `\d{2}`).Replace(escaped)
+	return regexp.MustCompile("(" + pattern + ")")
+}
+
+// Formats the daily index name for the given time, using the configured prefix, separator
+// and date format (e.g. IndexPrefix "logstash", separator "-", format "2006.01.02" ->
+// "logstash-2024.01.15").
+func formatIndexName(target *SearchTarget, t time.Time) string {
+	return target.IndexPrefix + target.IndexDateSeparator + t.Format(target.IndexDateFormat)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func findIndicesForDateRange(indices []string, target *SearchTarget, startDate string, endDate string, loc *time.Location) []string {
+	start := extractUserDate(startDate, loc)
+	end := extractUserDate(endDate, loc)
 	result := make([]string, 0, len(indices))
 	for _, idx := range indices {
-		matched, _ := regexp.MatchString(indexPattern, idx)
+		matched, _ := regexp.MatchString(target.IndexPattern, idx)
 		if matched {
-			idxDate := extractYMDDate(idx, ".")
+			idxDate := extractIndexDate(idx, target, loc)
 			if (idxDate.After(start) || idxDate.Equal(start)) && (idxDate.Before(end) || idxDate.Equal(end)) {
 				result = append(result, idx)
 			}
@@ -326,13 +649,10 @@ func main() {
 			cli.ShowAppHelp(c)
 			os.Exit(0)
 		}
-		if config.MoreVerbose || config.TraceRequests {
-			InitLogging(os.Stderr, os.Stderr, os.Stderr, true)
-		} else if config.Verbose {
-			InitLogging(ioutil.Discard, os.Stderr, os.Stderr, false)
-		} else {
-			InitLogging(ioutil.Discard, ioutil.Discard, os.Stderr, false)
-		}
+		config.QueryDefinition.Filters = c.StringSlice("filter")
+		config.ColorRules = c.StringSlice("color")
+		config.FormatExplicit = c.IsSet("format")
+		InitLoggingFromConfig(config)
 		if !IsConfigRelevantFlagSet(c) {
 			loadedConfig, err := LoadDefault()
 			if err != nil {
@@ -361,6 +681,9 @@ func main() {
 		//reset TunnelUrl to nothing, we'll point to the tunnel if we actually manage to create it
 		config.SearchTarget.TunnelUrl = ""
 		if config.SSHTunnelParams != "" {
+			if strings.Contains(config.SearchTarget.Url, ",") {
+				Error.Fatalf("--ssh-tunnel does not support a multi-node --url; give a single Elasticsearch URL to tunnel to.")
+			}
 			//We need to start ssh tunnel and make el client connect to local port at localhost in order to pass
 			//traffic through the tunnel
 			elurl, err := url.Parse(config.SearchTarget.Url)
@@ -414,10 +737,31 @@ func main() {
 		tail.Start(!config.IsListOnly(), config.InitialEntries)
 	}
 
+	app.Commands = []cli.Command{
+		kafkaCommand(config),
+	}
+
 	app.Run(os.Args)
 
 }
 
+// normalizeURL adds a scheme and default port to a single Elasticsearch node URL given on
+// the command line, e.g. "es1:9200" -> "http://es1:9200" or "https://es1" -> "https://es1:9200".
+func normalizeURL(url string) string {
+	url = strings.TrimSpace(url)
+	if !strings.HasPrefix(url, "http") {
+		url = "http://" + url
+		Trace.Printf("Adding http:// prefix to given url. Url: " + url)
+	}
+
+	if !Must(regexp.MatchString(".*:\\d+", url)) && Must(regexp.MatchString("https?://[^/]+$", url)) {
+		url += ":9200"
+		Trace.Printf("No port was specified, adding default port 9200 to given url. Url: " + url)
+	}
+
+	return url
+}
+
 // Helper function to avoid boilerplate error handling for regex matches
 // this way they may be used in single value context
 func Must(result bool, err error) bool {
@@ -466,4 +810,27 @@ func EvaluateExpression(model interface{}, fieldExpression string) (string, erro
 		nextExpression = parts[1]
 	}
 	return EvaluateExpression(nextModel, nextExpression)
-}
\ No newline at end of file
+}
+
+// EvaluateRawExpression works like EvaluateExpression, but returns the raw value found at
+// the expression's path (preserving its type) instead of a formatted string. ok is false if
+// the expression could not be evaluated against the model.
+func EvaluateRawExpression(model interface{}, fieldExpression string) (interface{}, bool) {
+	if fieldExpression == "" {
+		return model, true
+	}
+	parts := strings.SplitN(fieldExpression, ".", 2)
+	expression := parts[0]
+	modelMap, ok := model.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	value, ok := modelMap[expression]
+	if !ok {
+		return nil, false
+	}
+	if len(parts) == 1 {
+		return value, true
+	}
+	return EvaluateRawExpression(value, parts[1])
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/fatih/color"
+)
+
+// highlightPreTag and highlightPostTag mark the bounds of a matched term inside an
+// Elasticsearch highlight fragment. They're passed as Highlight.PreTags/PostTags so that
+// colorizeHighlightTags can find and colorize exactly the matched spans, not whole fragments.
+const highlightPreTag = "\x01"
+const highlightPostTag = "\x02"
+
+// OutputFormatter renders a single result entry for printing. highlight carries any
+// Elasticsearch highlight fragments for the hit, keyed by field expression (nil if
+// highlighting wasn't requested or the source has none, e.g. Kafka records). ok is false if
+// the entry should be skipped entirely (e.g. a field referenced by --format is missing).
+type OutputFormatter interface {
+	Format(entry map[string]interface{}, highlight map[string][]string) (line string, ok bool)
+}
+
+// NewOutputFormatter builds the OutputFormatter selected by configuration.Output.
+func NewOutputFormatter(configuration *Configuration) (OutputFormatter, error) {
+	colorRules, err := parseColorRules(configuration.ColorRules)
+	if err != nil {
+		return nil, err
+	}
+
+	switch configuration.Output {
+	case "", "text":
+		return &textFormatter{format: configuration.QueryDefinition.Format, colorRules: colorRules}, nil
+	case "json":
+		return &jsonFormatter{format: projectionFormat(configuration), pretty: true}, nil
+	case "ndjson":
+		return &jsonFormatter{format: projectionFormat(configuration)}, nil
+	case "template":
+		if configuration.Template == "" {
+			return nil, fmt.Errorf("--output template requires --template")
+		}
+		tmpl, err := template.New("output").Parse(configuration.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --template: %s", err)
+		}
+		return &templateFormatter{template: tmpl}, nil
+	default:
+		return nil, fmt.Errorf("unknown --output mode: %s (want text, json, ndjson or template)", configuration.Output)
+	}
+}
+
+// textFormatter is the original %field.subfield substitution format. A substituted field is
+// colorized when it matches a --color rule or carries Elasticsearch highlight fragments; if
+// nothing was colorized the whole line falls back to the original unconditional green.
+type textFormatter struct {
+	format     string
+	colorRules []ColorRule
+}
+
+func (f *textFormatter) Format(entry map[string]interface{}, highlight map[string][]string) (string, bool) {
+	fields := formatRegexp.FindAllString(f.format, -1)
+	result := f.format
+	colored := false
+	for _, field := range fields {
+		expression := field[1:]
+		value, err := EvaluateExpression(entry, expression)
+		if err != nil {
+			continue
+		}
+		switch rule := matchColorRule(f.colorRules, expression, value); {
+		case rule != nil:
+			value = rule.Color.Sprint(value)
+			colored = true
+		case len(highlight[expression]) > 0:
+			value = renderHighlightFragments(highlight[expression])
+			colored = true
+		}
+		result = strings.Replace(result, field, value, -1)
+	}
+	if colored {
+		return result, true
+	}
+	return color.GreenString(result), true
+}
+
+// ColorRule colors a field's value with a fixed terminal color when it matches exactly,
+// e.g. "level" == "ERROR" -> red. Parsed from a repeatable --color field=value:color[,...] flag.
+type ColorRule struct {
+	Field string
+	Value string
+	Color *color.Color
+}
+
+// parseColorRules parses repeated --color flags of the form
+// "field=value:color[,value:color...]" (e.g. "level=ERROR:red,WARN:yellow") into ColorRules.
+func parseColorRules(raw []string) ([]ColorRule, error) {
+	var rules []ColorRule
+	for _, entry := range raw {
+		field, rest, ok := splitFilterArg(entry)
+		if !ok {
+			return nil, fmt.Errorf("invalid --color %q, expected field=value:color[,value:color...]", entry)
+		}
+		for _, pair := range strings.Split(rest, ",") {
+			parts := strings.SplitN(pair, ":", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return nil, fmt.Errorf("invalid --color %q, expected value:color", pair)
+			}
+			c, err := colorByName(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid --color %q: %s", pair, err)
+			}
+			rules = append(rules, ColorRule{Field: field, Value: parts[0], Color: c})
+		}
+	}
+	return rules, nil
+}
+
+// matchColorRule returns the first rule whose field and value exactly match, or nil.
+func matchColorRule(rules []ColorRule, field string, value string) *ColorRule {
+	for i := range rules {
+		if rules[i].Field == field && rules[i].Value == value {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+var colorsByName = map[string]color.Attribute{
+	"black":   color.FgBlack,
+	"red":     color.FgRed,
+	"green":   color.FgGreen,
+	"yellow":  color.FgYellow,
+	"blue":    color.FgBlue,
+	"magenta": color.FgMagenta,
+	"cyan":    color.FgCyan,
+	"white":   color.FgWhite,
+}
+
+func colorByName(name string) (*color.Color, error) {
+	attr, ok := colorsByName[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown color %q", name)
+	}
+	return color.New(attr), nil
+}
+
+// renderHighlightFragments joins a field's highlight fragments, colorizing the spans
+// Elasticsearch marked with highlightPreTag/highlightPostTag and leaving the rest as-is.
+func renderHighlightFragments(fragments []string) string {
+	hlColor := color.New(color.FgHiYellow, color.Bold)
+	parts := make([]string, 0, len(fragments))
+	for _, fragment := range fragments {
+		parts = append(parts, colorizeHighlightTags(fragment, hlColor))
+	}
+	return strings.Join(parts, " ... ")
+}
+
+// colorizeHighlightTags replaces each highlightPreTag/highlightPostTag-delimited span in
+// fragment with the same text wrapped in hlColor's ANSI codes.
+func colorizeHighlightTags(fragment string, hlColor *color.Color) string {
+	var b strings.Builder
+	rest := fragment
+	for {
+		start := strings.Index(rest, highlightPreTag)
+		if start == -1 {
+			b.WriteString(rest)
+			break
+		}
+		b.WriteString(rest[:start])
+		rest = rest[start+len(highlightPreTag):]
+
+		end := strings.Index(rest, highlightPostTag)
+		if end == -1 {
+			b.WriteString(rest)
+			break
+		}
+		b.WriteString(hlColor.Sprint(rest[:end]))
+		rest = rest[end+len(highlightPostTag):]
+	}
+	return b.String()
+}
+
+// projectionFormat returns the --format string jsonFormatter should project its output down
+// to, or "" to emit the full raw source. --format defaults to "%message" so it is never
+// empty on its own; gating on configuration.FormatExplicit (rather than the string being
+// empty) is what lets "--output json" alone emit the full source for piping to jq.
+func projectionFormat(configuration *Configuration) string {
+	if !configuration.FormatExplicit {
+		return ""
+	}
+	return configuration.QueryDefinition.Format
+}
+
+// jsonFormatter emits either the full raw entry, or - if a --format was given - a
+// projection of just the fields it references, so results can be piped to jq, fluent-bit
+// or another consumer. "json" pretty-prints; "ndjson" emits one compact object per line.
+type jsonFormatter struct {
+	format string
+	pretty bool
+}
+
+func (f *jsonFormatter) Format(entry map[string]interface{}, highlight map[string][]string) (string, bool) {
+	var payload interface{} = entry
+
+	fields := formatRegexp.FindAllString(f.format, -1)
+	if len(fields) > 0 {
+		projection := make(map[string]interface{}, len(fields))
+		for _, field := range fields {
+			expression := field[1:]
+			if value, ok := EvaluateRawExpression(entry, expression); ok {
+				projection[expression] = value
+			}
+		}
+		payload = projection
+	}
+
+	var data []byte
+	var err error
+	if f.pretty {
+		data, err = json.MarshalIndent(payload, "", "  ")
+	} else {
+		data, err = json.Marshal(payload)
+	}
+	if err != nil {
+		Error.Println("Failed to marshal entry to JSON.", err)
+		return "", false
+	}
+	return string(data), true
+}
+
+// templateFormatter evaluates a user-supplied text/template against the entry map, for
+// users who need conditionals, ranges over arrays, or default values that the %field
+// substitution format can't express.
+type templateFormatter struct {
+	template *template.Template
+}
+
+func (f *templateFormatter) Format(entry map[string]interface{}, highlight map[string][]string) (string, bool) {
+	var buf bytes.Buffer
+	if err := f.template.Execute(&buf, entry); err != nil {
+		Error.Println("Failed to evaluate --template.", err)
+		return "", false
+	}
+	return buf.String(), true
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+func TestJsonFormatterEmitsFullSourceWithoutAFormat(t *testing.T) {
+	f := &jsonFormatter{format: ""}
+	entry := map[string]interface{}{"message": "hello", "level": "INFO"}
+	line, ok := f.Format(entry, nil)
+	if !ok {
+		t.Fatal("expected Format to succeed")
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &got); err != nil {
+		t.Fatalf("expected valid JSON, got error %s for %q", err, line)
+	}
+	if got["message"] != "hello" || got["level"] != "INFO" {
+		t.Fatalf("expected the full entry, got %v", got)
+	}
+}
+
+func TestJsonFormatterProjectsGivenFormat(t *testing.T) {
+	f := &jsonFormatter{format: "%message"}
+	entry := map[string]interface{}{"message": "hello", "level": "INFO"}
+	line, ok := f.Format(entry, nil)
+	if !ok {
+		t.Fatal("expected Format to succeed")
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &got); err != nil {
+		t.Fatalf("expected valid JSON, got error %s for %q", err, line)
+	}
+	if _, present := got["level"]; present {
+		t.Fatalf("expected level to be projected out, got %v", got)
+	}
+	if got["message"] != "hello" {
+		t.Fatalf("expected message to be kept, got %v", got)
+	}
+}
+
+func TestProjectionFormatGatesOnFormatExplicit(t *testing.T) {
+	configuration := &Configuration{QueryDefinition: QueryDefinition{Format: "%message"}}
+
+	if got := projectionFormat(configuration); got != "" {
+		t.Fatalf("expected no projection when --format wasn't explicitly given, got %q", got)
+	}
+
+	configuration.FormatExplicit = true
+	if got := projectionFormat(configuration); got != "%message" {
+		t.Fatalf("expected the configured format once --format is explicit, got %q", got)
+	}
+}
+
+func TestParseColorRules(t *testing.T) {
+	rules, err := parseColorRules([]string{"level=ERROR:red,WARN:yellow"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("expected 2 rules, got %d", len(rules))
+	}
+	if rules[0].Field != "level" || rules[0].Value != "ERROR" {
+		t.Fatalf("unexpected first rule: %+v", rules[0])
+	}
+	if rules[1].Field != "level" || rules[1].Value != "WARN" {
+		t.Fatalf("unexpected second rule: %+v", rules[1])
+	}
+}
+
+func TestParseColorRulesRejectsUnknownColor(t *testing.T) {
+	if _, err := parseColorRules([]string{"level=ERROR:chartreuse"}); err == nil {
+		t.Fatal("expected an error for an unknown color name")
+	}
+}
+
+func TestParseColorRulesRejectsMalformedEntry(t *testing.T) {
+	if _, err := parseColorRules([]string{"level"}); err == nil {
+		t.Fatal("expected an error for an entry missing '='")
+	}
+}
+
+func TestMatchColorRule(t *testing.T) {
+	rules := []ColorRule{{Field: "level", Value: "ERROR", Color: color.New(color.FgRed)}}
+	if matchColorRule(rules, "level", "ERROR") == nil {
+		t.Fatal("expected a match on field+value")
+	}
+	if matchColorRule(rules, "level", "INFO") != nil {
+		t.Fatal("expected no match for a different value")
+	}
+}
+
+func TestColorizeHighlightTagsWrapsMatchedSpans(t *testing.T) {
+	fragment := "before " + highlightPreTag + "needle" + highlightPostTag + " after"
+	got := colorizeHighlightTags(fragment, color.New(color.FgHiYellow))
+	want := "before " + color.New(color.FgHiYellow).Sprint("needle") + " after"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestColorizeHighlightTagsPassesThroughUntaggedText(t *testing.T) {
+	got := colorizeHighlightTags("plain text", color.New(color.FgHiYellow))
+	if got != "plain text" {
+		t.Fatalf("expected untagged text to pass through unchanged, got %q", got)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+type sshEndpoint struct {
+	User string
+	Host string
+	Port int
+}
+
+// SSHTunnel proxies a local TCP port to a remote host/port through an SSH server.
+type SSHTunnel struct {
+	Local  *sshEndpoint
+	Server *sshEndpoint
+	Remote *sshEndpoint
+	Config *sshEndpoint
+}
+
+// Builds an SSHTunnel from a "user@host[:port]" tunnel spec and the remote host:port to reach
+// once connected to that SSH server.
+func NewSSHTunnelFromHostStrings(tunnelSpec string, remoteHostPort string) *SSHTunnel {
+	userHost := strings.SplitN(tunnelSpec, "@", 2)
+	user := ""
+	hostPort := tunnelSpec
+	if len(userHost) == 2 {
+		user = userHost[0]
+		hostPort = userHost[1]
+	}
+	serverHost, serverPort := splitHostPort(hostPort, 22)
+	remoteHost, remotePort := splitHostPort(remoteHostPort, 80)
+
+	return &SSHTunnel{
+		Local:  &sshEndpoint{Host: "localhost", Port: freePort()},
+		Server: &sshEndpoint{Host: serverHost, Port: serverPort},
+		Remote: &sshEndpoint{Host: remoteHost, Port: remotePort},
+		Config: &sshEndpoint{User: user},
+	}
+}
+
+// Start blocks, accepting local connections and forwarding them through the SSH server
+// to the remote host. It is intended to be run in its own goroutine.
+//
+// SSH tunneling isn't implemented in this build - callers otherwise proceed to point the
+// Elasticsearch client at the tunnel's (never-opened) local port and fail with confusing
+// connection errors, so fail loudly and immediately instead.
+func (tunnel *SSHTunnel) Start() {
+	Error.Fatalln("--ssh-tunnel was given, but SSH tunneling is not available in this build.")
+}
+
+func splitHostPort(hostPort string, defaultPort int) (string, int) {
+	host, portStr, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return hostPort, defaultPort
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return host, defaultPort
+	}
+	return host, port
+}
+
+func freePort() int {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
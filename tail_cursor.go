@@ -0,0 +1,28 @@
+package main
+
+// TailCursor tracks where a poll-to-poll tail has gotten to, so that a burst of more than
+// one page of new documents landing between polls can be drained in full instead of being
+// truncated to a single From(0).Size(n) page.
+//
+// gopkg.in/olivere/elastic.v2 predates search_after, so once a poll turns up a full page
+// the cursor becomes a scroll_id; it is cleared (and a fresh timestamp range query takes
+// over) whenever the scroll is exhausted, which also gives us a natural point to re-resolve
+// tail.indices in case a new daily index has rolled in.
+//
+// The tiebreaker this scrolling scheme needs (multiple hits sharing the exact boundary
+// timestamp) isn't part of the cursor itself: it lives alongside lastTimeStamp as
+// Tail.lastTimeStampIds, since it has to survive the cursor being reset just as much as
+// lastTimeStamp does. See Tail.advanceWatermark and buildTimestampFilteredQuery.
+type TailCursor struct {
+	ScrollId string
+}
+
+// Active returns true if a scroll is currently open and should be used for the next page.
+func (c *TailCursor) Active() bool {
+	return c.ScrollId != ""
+}
+
+// Reset clears the cursor, forcing the next page to start a fresh, non-scrolled query.
+func (c *TailCursor) Reset() {
+	c.ScrollId = ""
+}
@@ -0,0 +1,70 @@
+package main
+
+import "testing"
+
+func TestTailCursorActive(t *testing.T) {
+	var c TailCursor
+	if c.Active() {
+		t.Fatal("expected a zero-value TailCursor to be inactive")
+	}
+	c.ScrollId = "abc123"
+	if !c.Active() {
+		t.Fatal("expected a TailCursor with a ScrollId to be active")
+	}
+}
+
+func TestTailCursorReset(t *testing.T) {
+	c := TailCursor{ScrollId: "abc123"}
+	c.Reset()
+	if c.Active() {
+		t.Fatal("expected Reset to clear ScrollId and make the cursor inactive")
+	}
+}
+
+func TestAdvanceWatermarkAdvancesOnNewerTimestamp(t *testing.T) {
+	tail := &Tail{}
+	tail.advanceWatermark("2024-01-01T00:00:00Z", "id-1")
+	if tail.lastTimeStamp != "2024-01-01T00:00:00Z" {
+		t.Fatalf("expected lastTimeStamp to be set, got %q", tail.lastTimeStamp)
+	}
+	if !tail.lastTimeStampIds["id-1"] {
+		t.Fatalf("expected id-1 to be tracked at the new watermark")
+	}
+
+	tail.advanceWatermark("2024-01-01T00:00:01Z", "id-2")
+	if tail.lastTimeStamp != "2024-01-01T00:00:01Z" {
+		t.Fatalf("expected lastTimeStamp to advance, got %q", tail.lastTimeStamp)
+	}
+	if tail.lastTimeStampIds["id-1"] {
+		t.Fatal("expected the id set to reset when the watermark advances to a newer timestamp")
+	}
+	if !tail.lastTimeStampIds["id-2"] {
+		t.Fatal("expected id-2 to be tracked at the new watermark")
+	}
+}
+
+func TestAdvanceWatermarkAccumulatesTiebreakerIdsAtSameTimestamp(t *testing.T) {
+	tail := &Tail{}
+	tail.advanceWatermark("2024-01-01T00:00:00Z", "id-1")
+	tail.advanceWatermark("2024-01-01T00:00:00Z", "id-2")
+
+	if tail.lastTimeStamp != "2024-01-01T00:00:00Z" {
+		t.Fatalf("expected lastTimeStamp to stay put, got %q", tail.lastTimeStamp)
+	}
+	if !tail.lastTimeStampIds["id-1"] || !tail.lastTimeStampIds["id-2"] {
+		t.Fatalf("expected both ids sharing the boundary timestamp to be tracked, got %v", tail.lastTimeStampIds)
+	}
+}
+
+func TestAdvanceWatermarkIgnoresOlderTimestamp(t *testing.T) {
+	tail := &Tail{}
+	tail.advanceWatermark("2024-01-01T00:00:01Z", "id-2")
+	tail.advanceWatermark("2024-01-01T00:00:00Z", "id-1")
+
+	if tail.lastTimeStamp != "2024-01-01T00:00:01Z" {
+		t.Fatalf("expected lastTimeStamp to stay at the newer value, got %q", tail.lastTimeStamp)
+	}
+	if tail.lastTimeStampIds["id-1"] {
+		t.Fatal("expected an id behind the watermark not to be tracked")
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// buildHTTPClient builds the *http.Client used to talk to Elasticsearch, configured with
+// client/CA certificates when given. It returns nil (meaning: use the library default) if
+// none of the TLS-related flags were set.
+func buildHTTPClient(configuration *Configuration) (*http.Client, error) {
+	if configuration.CACert == "" && configuration.ClientCert == "" && configuration.ClientKey == "" && !configuration.InsecureSkipVerify {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: configuration.InsecureSkipVerify}
+
+	if configuration.CACert != "" {
+		caCert, err := ioutil.ReadFile(configuration.CACert)
+		if err != nil {
+			return nil, err
+		}
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("could not parse CA certificate: %s", configuration.CACert)
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+
+	if configuration.ClientCert != "" || configuration.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(configuration.ClientCert, configuration.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}, nil
+}
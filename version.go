@@ -0,0 +1,4 @@
+package main
+
+// VERSION is the current release version, bumped on tag.
+const VERSION = "0.4.0"